@@ -0,0 +1,175 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/uber/cherami-server/common"
+)
+
+// externalPlacementTimeout bounds how long ExternalPlacement waits for the
+// configured endpoint to respond before falling back to an error, so a
+// wedged external service can't hang extent creation indefinitely.
+const externalPlacementTimeout = 5 * time.Second
+
+// externalPlacementRequest is the payload POSTed to the configured
+// endpoint; Service identifies which pool (input/output/store) the
+// request is for, and SourceUUIDs carries the UUIDs of the store hosts
+// already chosen when picking an input or output host.
+type externalPlacementRequest struct {
+	Service     string   `json:"service"`
+	Count       int      `json:"count"`
+	SourceUUIDs []string `json:"sourceUUIDs,omitempty"`
+}
+
+// externalPlacementResponse is the expected JSON response: the UUIDs of
+// the hosts the external strategy picked, resolved back to *common.HostInfo
+// via the ring-pin membership provider.
+type externalPlacementResponse struct {
+	HostUUIDs []string `json:"hostUUIDs"`
+}
+
+// ExternalPlacement delegates placement decisions to a user-provided
+// HTTP endpoint (a JSON request POSTed per decision; Thrift endpoints are
+// not supported), so that sites can experiment with rack-aware,
+// availability-zone-spread, or ML-driven placement without forking the
+// controller.
+type ExternalPlacement struct {
+	context  *Context
+	endpoint string
+	client   *http.Client
+}
+
+// NewExternalPlacement constructs an ExternalPlacement strategy that calls
+// out to ControllerConfig.GetExternalPlacementEndpoint() for every
+// decision.
+func NewExternalPlacement(context *Context) (Placement, error) {
+	endpoint := context.appConfig.GetControllerConfig().GetExternalPlacementEndpoint()
+	if endpoint == "" {
+		return nil, fmt.Errorf("external placement strategy selected but ExternalPlacementEndpoint is not configured")
+	}
+
+	return &ExternalPlacement{
+		context:  context,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: externalPlacementTimeout},
+	}, nil
+}
+
+func (p *ExternalPlacement) pick(service string, count int, sourceHosts []*common.HostInfo) ([]*common.HostInfo, error) {
+	req := externalPlacementRequest{Service: service, Count: count}
+	for _, h := range sourceHosts {
+		req.SourceUUIDs = append(req.SourceUUIDs, h.UUID)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Post(p.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("external placement endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result externalPlacementResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	hosts := make([]*common.HostInfo, 0, len(result.HostUUIDs))
+	for _, uuid := range result.HostUUIDs {
+		host, err := p.context.rpm.FindHostForUUID(service, uuid)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+
+	return hosts, nil
+}
+
+// PickInputHost asks the external endpoint for an input host
+func (p *ExternalPlacement) PickInputHost(storeHosts []*common.HostInfo) (*common.HostInfo, error) {
+	hosts, err := p.pick(common.InputServiceName, 1, storeHosts)
+	if err != nil || len(hosts) != 1 {
+		return &common.HostInfo{}, errNoInputHosts
+	}
+	return hosts[0], nil
+}
+
+// PickOutputHost asks the external endpoint for an output host
+func (p *ExternalPlacement) PickOutputHost(storeHosts []*common.HostInfo) (*common.HostInfo, error) {
+	hosts, err := p.pick(common.OutputServiceName, 1, storeHosts)
+	if err != nil || len(hosts) != 1 {
+		return &common.HostInfo{}, errNoOutputHosts
+	}
+	return hosts[0], nil
+}
+
+// PickStoreHosts asks the external endpoint for count store hosts
+func (p *ExternalPlacement) PickStoreHosts(count int) ([]*common.HostInfo, error) {
+	hosts, err := p.pick(common.StoreServiceName, count, nil)
+	if err != nil || len(hosts) != count {
+		return nil, errNoStoreHosts
+	}
+	return hosts, nil
+}
+
+// GetPlacementBreakdown is not supported for external placement -- the
+// rejection reasons, if any, live inside the external service.
+func (p *ExternalPlacement) GetPlacementBreakdown(serviceName string) (*PlacementBreakdown, error) {
+	return &PlacementBreakdown{}, nil
+}
+
+// ReloadTopology is a no-op since ExternalPlacement doesn't consult a
+// local topology file.
+func (p *ExternalPlacement) ReloadTopology() error {
+	return nil
+}
+
+// TopologyStatus is a zero value since ExternalPlacement doesn't consult a
+// local topology file.
+func (p *ExternalPlacement) TopologyStatus() (checksum string, modTime time.Time) {
+	return "", time.Time{}
+}
+
+// PlacementDebug is not supported for external placement -- scoring, if
+// any, happens inside the external service.
+func (p *ExternalPlacement) PlacementDebug() ([]*StoreHostScore, error) {
+	return nil, nil
+}
+
+// Close is a no-op since ExternalPlacement doesn't start any background
+// goroutines -- every decision is a synchronous call to the endpoint.
+func (p *ExternalPlacement) Close() error {
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/uber/cherami-server/common"
+)
+
+// hostExtentStats summarizes how many extents a store host currently owns,
+// as last observed from the metadata store.
+type hostExtentStats struct {
+	ActiveExtentCount int64
+	TotalBytesStored  int64
+}
+
+// defaultHostExtentLoadRefreshInterval is used when the controller config
+// doesn't specify a refresh interval for the extent load tracker.
+const defaultHostExtentLoadRefreshInterval = time.Minute
+
+// hostExtentLoadTracker periodically queries the metadata store to build a
+// live view of how many extents each store host owns. Unlike the old
+// package-level rrMap counter, this view survives controller restarts and
+// reflects the actual state of the cluster rather than just the placement
+// calls this process happened to handle.
+type hostExtentLoadTracker struct {
+	context   *Context
+	interval  time.Duration
+	stats     atomic.Value // map[string]hostExtentStats, keyed by store host UUID
+	shutdownC chan struct{}
+}
+
+// newHostExtentLoadTracker creates a tracker that refreshes on the given
+// interval. Call Start to begin the background refresh goroutine.
+func newHostExtentLoadTracker(context *Context, interval time.Duration) *hostExtentLoadTracker {
+	if interval <= 0 {
+		interval = defaultHostExtentLoadRefreshInterval
+	}
+	t := &hostExtentLoadTracker{
+		context:   context,
+		interval:  interval,
+		shutdownC: make(chan struct{}),
+	}
+	t.stats.Store(make(map[string]hostExtentStats))
+	return t
+}
+
+// Start spawns the background goroutine that keeps the extent load map
+// up to date. It performs one synchronous refresh before returning so that
+// callers immediately have a populated map to work with.
+func (t *hostExtentLoadTracker) Start() {
+	t.refresh()
+	go t.pollLoop()
+}
+
+// Stop terminates the background refresh goroutine.
+func (t *hostExtentLoadTracker) Stop() {
+	close(t.shutdownC)
+}
+
+func (t *hostExtentLoadTracker) pollLoop() {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.refresh()
+		case <-t.shutdownC:
+			return
+		}
+	}
+}
+
+// Get returns the last observed extent stats for the given store host UUID.
+func (t *hostExtentLoadTracker) Get(hostUUID string) (hostExtentStats, bool) {
+	stats, ok := t.stats.Load().(map[string]hostExtentStats)[hostUUID]
+	return stats, ok
+}
+
+// refresh rebuilds the extent load map from the metadata store. It relies
+// on mm.ListActiveStoreExtents() returning, per active extent, the store
+// UUIDs currently hosting a replica (StoreUUIDs) and the extent's size in
+// bytes (SizeBytes) -- the same two facts ExtentCount-based placement
+// already needed from the metadata store elsewhere. Errors are logged and
+// swallowed -- on failure the tracker keeps serving the previously
+// observed map rather than flushing it to empty.
+func (t *hostExtentLoadTracker) refresh() {
+	extents, err := t.context.mm.ListActiveStoreExtents()
+	if err != nil {
+		t.context.log.WithField(common.TagErr, err).Error(`hostExtentLoadTracker: failed to list active extents`)
+		return
+	}
+
+	t.stats.Store(aggregateExtentStats(extents))
+}
+
+// aggregateExtentStats is the pure part of refresh: folding a flat list of
+// active extents into per-store-host stats. Split out so the aggregation
+// logic (in particular, how a multi-replica extent counts against every
+// store that holds it) can be unit tested without a metadata manager.
+func aggregateExtentStats(extents []*common.Extent) map[string]hostExtentStats {
+	next := make(map[string]hostExtentStats)
+	for _, e := range extents {
+		for _, storeUUID := range e.StoreUUIDs {
+			stats := next[storeUUID]
+			stats.ActiveExtentCount++
+			stats.TotalBytesStored += e.SizeBytes
+			next[storeUUID] = stats
+		}
+	}
+	return next
+}
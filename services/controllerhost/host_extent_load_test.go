@@ -0,0 +1,56 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/cherami-server/common"
+)
+
+func TestAggregateExtentStats(t *testing.T) {
+	extents := []*common.Extent{
+		{StoreUUIDs: []string{"s1", "s2"}, SizeBytes: 100},
+		{StoreUUIDs: []string{"s1"}, SizeBytes: 50},
+		{StoreUUIDs: []string{}, SizeBytes: 900}, // no replicas -- shouldn't count against anyone
+	}
+
+	got := aggregateExtentStats(extents)
+
+	assert.Equal(t, hostExtentStats{ActiveExtentCount: 2, TotalBytesStored: 150}, got["s1"])
+	assert.Equal(t, hostExtentStats{ActiveExtentCount: 1, TotalBytesStored: 100}, got["s2"])
+	assert.Len(t, got, 2)
+}
+
+func TestHostExtentLoadTrackerGet(t *testing.T) {
+	tracker := &hostExtentLoadTracker{}
+	tracker.stats.Store(map[string]hostExtentStats{
+		"s1": {ActiveExtentCount: 3, TotalBytesStored: 300},
+	})
+
+	stats, ok := tracker.Get("s1")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), stats.ActiveExtentCount)
+
+	_, ok = tracker.Get("unknown")
+	assert.False(t, ok, "an unobserved host should report !ok, not a zero-value stat")
+}
@@ -24,9 +24,12 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/uber-common/bark"
 	"github.com/uber/cherami-server/common"
@@ -47,22 +50,101 @@ type Placement interface {
 	PickOutputHost(storeHosts []*common.HostInfo) (*common.HostInfo, error)
 	// PickStoreHosts picks n store hosts with certain distance between store replicas
 	PickStoreHosts(count int) ([]*common.HostInfo, error)
+	// GetPlacementBreakdown returns the per-host reasons from the most recent
+	// placement decision for serviceName, for admin diagnostics
+	GetPlacementBreakdown(serviceName string) (*PlacementBreakdown, error)
+	// ReloadTopology forces an immediate reload of the topology file
+	ReloadTopology() error
+	// TopologyStatus returns the checksum and modification time of the
+	// topology file version currently in effect, so operators can confirm
+	// a replica has converged on a given topology change
+	TopologyStatus() (checksum string, modTime time.Time)
+	// PlacementDebug returns a per-host weighted-score breakdown for the
+	// current store host pool, for logging and admin diagnostics
+	PlacementDebug() ([]*StoreHostScore, error)
+	// Close stops any background goroutines the strategy started (topology
+	// watching, extent-load refresh, etc). Callers must invoke it when
+	// they're done with a Placement to avoid leaking those goroutines.
+	Close() error
 }
 
 // DistancePlacement holds the context and distance map
 type DistancePlacement struct {
-	context *Context
-	distMap distance.Map
+	context       *Context
+	topology      *topologyWatcher
+	extentLoad    *hostExtentLoadTracker
+	lastBreakdown *atomic.Value
 }
 
 // NewDistancePlacement initializes a new placement topology
 func NewDistancePlacement(context *Context) (Placement, error) {
-	distMap, err := distance.New(context.appConfig.GetControllerConfig().GetTopologyFile(), context.log)
-	// TODO: Add background goroutine to periodically reload the topology file
+	topology, err := newTopologyWatcher(context,
+		context.appConfig.GetControllerConfig().GetTopologyFile(),
+		context.appConfig.GetControllerConfig().GetTopologyPollInterval())
+	if err == nil {
+		topology.Start()
+	}
+
+	extentLoad := newHostExtentLoadTracker(context, context.appConfig.GetControllerConfig().GetHostExtentLoadRefreshInterval())
+	extentLoad.Start()
+
+	if err != nil {
+		// The caller can't be expected to Close() a value returned
+		// alongside a non-nil error, so stop what we already started here
+		// rather than leaking the extent-load refresh goroutine forever.
+		extentLoad.Stop()
+		return nil, err
+	}
+
 	return &DistancePlacement{
-		context: context,
-		distMap: distMap,
-	}, err
+		context:       context,
+		topology:      topology,
+		extentLoad:    extentLoad,
+		lastBreakdown: newPlacementBreakdownHolder(),
+	}, nil
+}
+
+// Close stops the topology watcher and extent-load tracker background
+// goroutines. Callers must invoke it when they're done with a
+// DistancePlacement.
+func (p *DistancePlacement) Close() error {
+	if p.topology != nil {
+		p.topology.Stop()
+	}
+	if p.extentLoad != nil {
+		p.extentLoad.Stop()
+	}
+	return nil
+}
+
+// ReloadTopology forces an immediate reload of the topology file, for the
+// admin RPC that lets operators push a topology change on demand rather
+// than waiting for the watcher to notice it.
+func (p *DistancePlacement) ReloadTopology() error {
+	if p.topology == nil {
+		return nil
+	}
+	return p.topology.ReloadTopology()
+}
+
+// TopologyStatus returns the checksum and modification time of the
+// topology file version currently in effect, or a zero value if the
+// topology watcher failed to load one.
+func (p *DistancePlacement) TopologyStatus() (checksum string, modTime time.Time) {
+	if p.topology == nil {
+		return "", time.Time{}
+	}
+	state := p.topology.currentState()
+	return state.checksum, state.modTime
+}
+
+// currentDistMap returns the distance.Map currently in effect, or nil if
+// the topology watcher failed to load one.
+func (p *DistancePlacement) currentDistMap() distance.Map {
+	if p.topology == nil {
+		return nil
+	}
+	return p.topology.currentMap()
 }
 
 // Helper function to convert host info into resource
@@ -75,9 +157,12 @@ func toResources(hosts []*common.HostInfo) []string {
 	return resources
 }
 
-// Helper function to pick hosts based on the predicates
-func (p *DistancePlacement) pickHosts(service string, poolHosts, sourceHosts []*common.HostInfo, count int, minDistance, maxDistance uint16) ([]*common.HostInfo, error) {
-	if p.distMap == nil {
+// Helper function to pick hosts based on the predicates. bb is optional --
+// when non-nil, any poolHosts the distance map rejects are recorded into it
+// for admin diagnostics.
+func (p *DistancePlacement) pickHosts(service string, poolHosts, sourceHosts []*common.HostInfo, count int, minDistance, maxDistance uint16, bb *breakdownBuilder) ([]*common.HostInfo, error) {
+	distMap := p.currentDistMap()
+	if distMap == nil {
 		return poolHosts[:count], nil
 	}
 
@@ -95,11 +180,23 @@ func (p *DistancePlacement) pickHosts(service string, poolHosts, sourceHosts []*
 		}
 	}
 
-	resources, err := p.distMap.FindResources(poolResources, sourceResources, "nic", count, minDistance, maxDistance)
+	resources, err := distMap.FindResources(poolResources, sourceResources, "nic", count, minDistance, maxDistance)
 	if err != nil {
 		return nil, err
 	}
 
+	if bb != nil {
+		matched := make(map[string]bool, len(resources))
+		for _, resource := range resources {
+			matched[resource] = true
+		}
+		for _, host := range poolHosts {
+			if resource := strings.Split(host.Addr, ":")[0]; !matched[resource] {
+				bb.markDistanceRejected(host.UUID)
+			}
+		}
+	}
+
 	var hosts []*common.HostInfo
 	for _, resource := range resources {
 		if port, ok := hostPortMap[resource]; !ok {
@@ -160,7 +257,15 @@ func (p *DistancePlacement) PickOutputHost(storeHosts []*common.HostInfo) (*comm
 // PickStoreHosts picks n store hosts with certain distance between store replicas
 func (p *DistancePlacement) PickStoreHosts(count int) ([]*common.HostInfo, error) {
 
-	if storeHosts, err := p.findEligibleStoreHosts(); err == nil {
+	storeHosts, bb, err := p.findEligibleStoreHosts()
+	if bb != nil {
+		// Store whatever breakdown we end up with, including any distance
+		// rejections recorded below, so GetPlacementBreakdown always
+		// reflects the outcome of the most recent placement attempt.
+		defer func() { p.lastBreakdown.Store(bb.build()) }()
+	}
+
+	if err == nil {
 
 		if len(storeHosts) < count {
 			return nil, errNoHosts
@@ -174,7 +279,14 @@ func (p *DistancePlacement) PickStoreHosts(count int) ([]*common.HostInfo, error
 		if maxDistance <= minDistance {
 			maxDistance = distance.InfiniteDistance
 		}
-		if hosts, e := p.pickHosts(common.StoreServiceName, storeHosts, nil, count, minDistance, maxDistance); e == nil {
+
+		if p.context.appConfig.GetControllerConfig().GetWeightedPlacementEnabled() {
+			if hosts, e := p.pickWeighted(common.StoreServiceName, storeHosts, count, minDistance, maxDistance, bb); e == nil {
+				return hosts, nil
+			}
+		}
+
+		if hosts, e := p.pickHosts(common.StoreServiceName, storeHosts, nil, count, minDistance, maxDistance, bb); e == nil {
 			return hosts, nil
 		}
 		minFallback := p.context.appConfig.GetControllerConfig().GetMinStoreToStoreFallbackDistance()
@@ -186,11 +298,11 @@ func (p *DistancePlacement) PickStoreHosts(count int) ([]*common.HostInfo, error
 			if maxFallback <= minFallback {
 				maxFallback = distance.InfiniteDistance
 			}
-			if hosts, e := p.pickHosts(common.StoreServiceName, storeHosts, nil, count, minFallback, maxFallback); e == nil {
+			if hosts, e := p.pickHosts(common.StoreServiceName, storeHosts, nil, count, minFallback, maxFallback, bb); e == nil {
 				return hosts, nil
 			}
 		}
-		
+
 		culledStoreHosts := p.roundRobinCull(storeHosts, count, `PickStoreHosts`)
 		if len(culledStoreHosts) == count {
 			return culledStoreHosts, nil
@@ -201,8 +313,14 @@ func (p *DistancePlacement) PickStoreHosts(count int) ([]*common.HostInfo, error
 }
 
 // doesStoreMeetConstraints returns true of the given storehost
-// meets all requirements to host a new extent.
-func (p *DistancePlacement) doesStoreMeetConstraints(host *common.HostInfo) bool {
+// meets all requirements to host a new extent. If bb is non-nil, the
+// reason for rejection (if any) is recorded into it for admin diagnostics.
+func (p *DistancePlacement) doesStoreMeetConstraints(host *common.HostInfo, bb *breakdownBuilder) bool {
+
+	var b *HostPlacementBreakdown
+	if bb != nil {
+		b = bb.record(host)
+	}
 
 	cfgObj, err := p.context.cfgMgr.Get(common.StoreServiceName, "*", host.Sku, host.Name)
 	if err != nil {
@@ -218,11 +336,40 @@ func (p *DistancePlacement) doesStoreMeetConstraints(host *common.HostInfo) bool
 		p.context.log.WithFields(bark.Fields{
 			common.TagHostIP: host.Addr,
 			`reason`:         "AdminDisabled"}).Info("Placement ignoring store host")
+		if b != nil {
+			b.addReason(&b.AdminDisabledReason, "AdminDisabled")
+			bb.emit(metricPlacementRejectedAdminDisabled)
+		}
 		return false
 	}
 
+	if softCap := p.context.appConfig.GetControllerConfig().GetStoreExtentSoftCap(); softCap > 0 {
+		if stats, ok := p.extentLoad.Get(host.UUID); ok && stats.ActiveExtentCount >= softCap {
+			p.context.log.WithFields(bark.Fields{
+				common.TagHostIP:    host.Addr,
+				`activeExtentCount`: stats.ActiveExtentCount,
+				`softCap`:           softCap,
+				`reason`:            "ExtentSoftCapReached"}).Info("Placement ignoring store host")
+			if b != nil {
+				b.addReason(&b.LoadReason, "ExtentSoftCapReached")
+				bb.emit(metricPlacementRejectedExtentSoftCap)
+			}
+			return false
+		}
+	}
+
 	val, err := p.context.loadMetrics.Get(host.UUID, load.EmptyTag, load.RemDiskSpaceBytes, load.OneMinAvg)
 	if err != nil {
+		// A missing health report (metrics-collector lag, a newly-joined
+		// host, a transient RPC hiccup) doesn't itself disqualify a host;
+		// fail open and just note it for diagnostics.
+		p.context.log.WithFields(bark.Fields{
+			common.TagHostIP: host.Addr,
+			`reason`:         "NoHealthReport"}).Info("Placement missing health report for store host")
+		if b != nil {
+			b.addInfoReason(&b.HealthReason, "NoHealthReport")
+			bb.emit(metricPlacementMissingHealthReport)
+		}
 		return true
 	}
 
@@ -231,26 +378,34 @@ func (p *DistancePlacement) doesStoreMeetConstraints(host *common.HostInfo) bool
 			common.TagHostIP:     host.Addr,
 			`freeDiskSpaceBytes`: val,
 			`reason`:             "DiskSpaceTooLow"}).Info("Placement ignoring store host")
+		if b != nil {
+			b.addReason(&b.DiskSpaceReason, "DiskSpaceTooLow")
+			bb.emit(metricPlacementRejectedDiskLow)
+		}
 		return false
 	}
 
 	return true
 }
 
-// findEligibleStoreHosts gets all store hosts and
-// filters them based on AdminStatus. Only returns
-// administratively enabled store hosts
-func (p *DistancePlacement) findEligibleStoreHosts() ([]*common.HostInfo, error) {
+// findEligibleStoreHosts gets all store hosts and filters them based on
+// AdminStatus, disk space and load. Only returns administratively enabled
+// store hosts. The returned breakdownBuilder already has one entry per
+// candidate host recording why doesStoreMeetConstraints rejected it (if it
+// did); the caller is responsible for persisting it via p.lastBreakdown
+// once any later distance-based rejections have been recorded too.
+func (p *DistancePlacement) findEligibleStoreHosts() ([]*common.HostInfo, *breakdownBuilder, error) {
 
 	storeHosts, err := p.context.rpm.GetHosts(common.StoreServiceName)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	bb := newBreakdownBuilder(p.context)
 	result := make([]*common.HostInfo, 0, len(storeHosts))
 
 	for _, h := range storeHosts {
-		if p.doesStoreMeetConstraints(h) {
+		if p.doesStoreMeetConstraints(h, bb) {
 			result = append(result, h)
 		}
 	}
@@ -258,10 +413,35 @@ func (p *DistancePlacement) findEligibleStoreHosts() ([]*common.HostInfo, error)
 	// If we didn't find any storehosts, let's say, because they are administratively
 	// disabled, then return an error so that the caller can handle appropriately.
 	if len(result) == 0 {
-		return nil, errNoStoreHosts
+		return nil, bb, errNoStoreHosts
 	}
 
-	return result, nil
+	// Weighted placement re-ranks the pool itself using ExtentCount as just
+	// one of several sub-scores, so sorting here would be immediately
+	// discarded -- skip it in that configuration.
+	if !p.context.appConfig.GetControllerConfig().GetWeightedPlacementEnabled() {
+		p.sortByExtentLoad(result)
+	}
+
+	return result, bb, nil
+}
+
+// sortByExtentLoad orders hosts so that the ones with the lowest live
+// extent count (and, as a tiebreaker, the fewest bytes stored) come first.
+// Hosts this controller hasn't observed in the metadata store yet sort
+// last, since we have no evidence they're lightly loaded.
+func (p *DistancePlacement) sortByExtentLoad(hosts []*common.HostInfo) {
+	sort.SliceStable(hosts, func(i, j int) bool {
+		si, iok := p.extentLoad.Get(hosts[i].UUID)
+		sj, jok := p.extentLoad.Get(hosts[j].UUID)
+		if iok != jok {
+			return iok
+		}
+		if si.ActiveExtentCount != sj.ActiveExtentCount {
+			return si.ActiveExtentCount < sj.ActiveExtentCount
+		}
+		return si.TotalBytesStored < sj.TotalBytesStored
+	})
 }
 
 var rrMap = map[string]int{}
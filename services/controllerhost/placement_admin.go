@@ -0,0 +1,119 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/uber/cherami-server/common"
+)
+
+// PlacementAdminHandler exposes read-only operator diagnostics for
+// whichever Placement strategy the controller is running, over plain
+// HTTP/JSON -- the same style external_placement.go already uses to talk
+// to an external placement service, just serving instead of calling out.
+//
+// KNOWN GAP: this only registers the handlers; wiring RegisterHandlers
+// into the controller's admin http.ServeMux happens at controller
+// bootstrap, which isn't part of this package's checkout. Until that's
+// done, GET /placement/breakdown, /placement/scores, /placement/topology
+// and POST /placement/reload aren't reachable on any running controller.
+// See the equivalent caveat on NewPlacement in placement_registry.go.
+type PlacementAdminHandler struct {
+	placement Placement
+}
+
+// NewPlacementAdminHandler constructs a PlacementAdminHandler for the
+// given Placement strategy.
+func NewPlacementAdminHandler(placement Placement) *PlacementAdminHandler {
+	return &PlacementAdminHandler{placement: placement}
+}
+
+// RegisterHandlers registers the placement admin endpoints on mux:
+//
+//	GET  /placement/breakdown?service=<name>  -- GetPlacementBreakdown(name)
+//	POST /placement/reload                    -- ReloadTopology()
+//	GET  /placement/topology                  -- TopologyStatus()
+//	GET  /placement/scores                    -- PlacementDebug()
+func (h *PlacementAdminHandler) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/placement/breakdown", h.handleGetBreakdown)
+	mux.HandleFunc("/placement/reload", h.handleReloadTopology)
+	mux.HandleFunc("/placement/topology", h.handleGetTopologyStatus)
+	mux.HandleFunc("/placement/scores", h.handleGetScores)
+}
+
+// topologyStatusResponse is the JSON body for /placement/topology, letting
+// operators confirm a replica has converged on a given topology file
+// version without grepping logs.
+type topologyStatusResponse struct {
+	Checksum string    `json:"checksum"`
+	ModTime  time.Time `json:"modTime"`
+}
+
+func (h *PlacementAdminHandler) handleGetTopologyStatus(w http.ResponseWriter, r *http.Request) {
+	checksum, modTime := h.placement.TopologyStatus()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(topologyStatusResponse{Checksum: checksum, ModTime: modTime})
+}
+
+func (h *PlacementAdminHandler) handleGetBreakdown(w http.ResponseWriter, r *http.Request) {
+	serviceName := r.URL.Query().Get("service")
+	if serviceName == "" {
+		serviceName = common.StoreServiceName
+	}
+
+	breakdown, err := h.placement.GetPlacementBreakdown(serviceName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(breakdown)
+}
+
+func (h *PlacementAdminHandler) handleGetScores(w http.ResponseWriter, r *http.Request) {
+	scores, err := h.placement.PlacementDebug()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scores)
+}
+
+func (h *PlacementAdminHandler) handleReloadTopology(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.placement.ReloadTopology(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/cherami-server/common"
+)
+
+// fakePlacement is a minimal Placement stub for exercising
+// PlacementAdminHandler without a real DistancePlacement/Context.
+type fakePlacement struct {
+	breakdown      *PlacementBreakdown
+	breakdownErr   error
+	reloadErr      error
+	reloadCalled   bool
+	lastServiceArg string
+	topoChecksum   string
+	topoModTime    time.Time
+	scores         []*StoreHostScore
+	scoresErr      error
+}
+
+func (f *fakePlacement) PickInputHost(storeHosts []*common.HostInfo) (*common.HostInfo, error) {
+	return nil, nil
+}
+func (f *fakePlacement) PickOutputHost(storeHosts []*common.HostInfo) (*common.HostInfo, error) {
+	return nil, nil
+}
+func (f *fakePlacement) PickStoreHosts(count int) ([]*common.HostInfo, error) { return nil, nil }
+func (f *fakePlacement) GetPlacementBreakdown(serviceName string) (*PlacementBreakdown, error) {
+	f.lastServiceArg = serviceName
+	return f.breakdown, f.breakdownErr
+}
+func (f *fakePlacement) ReloadTopology() error {
+	f.reloadCalled = true
+	return f.reloadErr
+}
+func (f *fakePlacement) TopologyStatus() (checksum string, modTime time.Time) {
+	return f.topoChecksum, f.topoModTime
+}
+func (f *fakePlacement) PlacementDebug() ([]*StoreHostScore, error) {
+	return f.scores, f.scoresErr
+}
+func (f *fakePlacement) Close() error { return nil }
+
+func TestPlacementAdminHandlerGetBreakdown(t *testing.T) {
+	fp := &fakePlacement{breakdown: &PlacementBreakdown{Hosts: []*HostPlacementBreakdown{
+		{HostUUID: "h1", Usable: true},
+	}}}
+	h := NewPlacementAdminHandler(fp)
+	mux := http.NewServeMux()
+	h.RegisterHandlers(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/placement/breakdown?service=cherami-store", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "cherami-store", fp.lastServiceArg)
+	assert.Contains(t, rr.Body.String(), `"h1"`)
+}
+
+func TestPlacementAdminHandlerReloadTopology(t *testing.T) {
+	fp := &fakePlacement{}
+	h := NewPlacementAdminHandler(fp)
+	mux := http.NewServeMux()
+	h.RegisterHandlers(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/placement/reload", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, fp.reloadCalled)
+
+	getReq := httptest.NewRequest(http.MethodGet, "/placement/reload", nil)
+	getRR := httptest.NewRecorder()
+	mux.ServeHTTP(getRR, getReq)
+	assert.Equal(t, http.StatusMethodNotAllowed, getRR.Code)
+}
+
+func TestPlacementAdminHandlerGetScores(t *testing.T) {
+	fp := &fakePlacement{scores: []*StoreHostScore{
+		{Host: &common.HostInfo{UUID: "h1"}, Total: 0.75},
+	}}
+	h := NewPlacementAdminHandler(fp)
+	mux := http.NewServeMux()
+	h.RegisterHandlers(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/placement/scores", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"h1"`)
+}
+
+func TestPlacementAdminHandlerNotYetMountedOnControllerBootstrap(t *testing.T) {
+	t.Skip("KNOWN GAP: RegisterHandlers is exercised above against a throwaway http.ServeMux, " +
+		"but nothing calls it against the controller's real admin http.ServeMux -- that wiring " +
+		"lives outside this package's checkout. Until it's added, GET /placement/breakdown, " +
+		"/placement/scores, /placement/topology and POST /placement/reload aren't reachable on " +
+		"any running controller. Remove this skip once the admin mux is actually wired up.")
+}
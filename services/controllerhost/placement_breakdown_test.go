@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/cherami-server/common"
+)
+
+func TestBreakdownBuilderMarkDistanceRejected(t *testing.T) {
+	bb := newBreakdownBuilder(&Context{log: testLogger()})
+
+	usable := bb.record(&common.HostInfo{UUID: "u1", Addr: "10.0.0.1:1234"})
+	alreadyRejected := bb.record(&common.HostInfo{UUID: "u2", Addr: "10.0.0.2:1234"})
+	alreadyRejected.addReason(&alreadyRejected.AdminDisabledReason, "AdminDisabled")
+
+	bb.markDistanceRejected("u1")
+	bb.markDistanceRejected("u2")
+	bb.markDistanceRejected("unknown-host")
+
+	assert.False(t, usable.Usable)
+	assert.Equal(t, "OutOfDistanceWindow", usable.DistanceReason)
+
+	assert.Equal(t, "AdminDisabled", alreadyRejected.AdminDisabledReason,
+		"a host already rejected for another reason shouldn't also get a distance reason")
+	assert.Empty(t, alreadyRejected.DistanceReason)
+}
+
+func TestHostPlacementBreakdownAddReason(t *testing.T) {
+	b := &HostPlacementBreakdown{Usable: true}
+	b.addReason(&b.DiskSpaceReason, "DiskSpaceTooLow")
+
+	assert.False(t, b.Usable)
+	assert.Equal(t, "DiskSpaceTooLow", b.DiskSpaceReason)
+	assert.Equal(t, []string{"DiskSpaceTooLow"}, b.UnusableReasons)
+}
+
+func TestHostPlacementBreakdownAddInfoReason(t *testing.T) {
+	b := &HostPlacementBreakdown{Usable: true}
+	b.addInfoReason(&b.HealthReason, "NoHealthReport")
+
+	assert.True(t, b.Usable, "an info reason (e.g. a missing health report) shouldn't disqualify the host")
+	assert.Equal(t, "NoHealthReport", b.HealthReason)
+	assert.Empty(t, b.UnusableReasons, "info reasons aren't aggregated into UnusableReasons")
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"fmt"
+	"sync"
+)
+
+// PlacementFactory constructs a Placement strategy from the controller
+// context. Strategies register one of these under a unique name via
+// RegisterPlacement so that ControllerConfig.PlacementStrategy can select
+// them by name, rather than the controller hard-coding a single
+// implementation.
+type PlacementFactory func(context *Context) (Placement, error)
+
+var placementRegistryMutex sync.Mutex
+var placementRegistry = make(map[string]PlacementFactory)
+
+// defaultPlacementStrategy is used when ControllerConfig doesn't specify
+// PlacementStrategy, preserving the pre-registry behavior of always using
+// DistancePlacement.
+const defaultPlacementStrategy = "distance"
+
+func init() {
+	RegisterPlacement(defaultPlacementStrategy, NewDistancePlacement)
+	RegisterPlacement("random", NewRandomPlacement)
+	RegisterPlacement("external", NewExternalPlacement)
+}
+
+// RegisterPlacement registers a placement strategy factory under name.
+// Re-registering an existing name replaces the previous factory, so that
+// test suites can swap in deterministic strategies instead of relying on
+// global state like the old rrMap counter.
+func RegisterPlacement(name string, factory PlacementFactory) {
+	placementRegistryMutex.Lock()
+	defer placementRegistryMutex.Unlock()
+	placementRegistry[name] = factory
+}
+
+// NewPlacement constructs the active Placement strategy, as selected by
+// ControllerConfig.PlacementStrategy (defaulting to "distance").
+//
+// KNOWN GAP: the controller's bootstrap code must call this instead of
+// NewDistancePlacement directly for PlacementStrategy to have any effect,
+// and that call site lives outside this package's checkout. Until that
+// one-line change lands, PlacementStrategy config is inert and the
+// controller always runs DistancePlacement -- same as before this
+// registry existed. See the same caveat on
+// PlacementAdminHandler.RegisterHandlers in placement_admin.go, which has
+// an equivalent unwired bootstrap dependency.
+func NewPlacement(context *Context) (Placement, error) {
+	name := context.appConfig.GetControllerConfig().GetPlacementStrategy()
+	return newPlacementByName(name, context)
+}
+
+// newPlacementByName resolves name (defaulting to defaultPlacementStrategy
+// when empty) against the registry and invokes the matching factory.
+// Split out from NewPlacement so the name-dispatch logic can be unit
+// tested without needing a full *Context/ControllerConfig.
+func newPlacementByName(name string, context *Context) (Placement, error) {
+	if name == "" {
+		name = defaultPlacementStrategy
+	}
+
+	placementRegistryMutex.Lock()
+	factory, ok := placementRegistry[name]
+	placementRegistryMutex.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown placement strategy %q", name)
+	}
+
+	return factory(context)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func registerFakeStrategies(t *testing.T) (calledName *string) {
+	calledName = new(string)
+	RegisterPlacement("fake-a", func(context *Context) (Placement, error) {
+		*calledName = "fake-a"
+		return &RandomPlacement{}, nil
+	})
+	RegisterPlacement("fake-b", func(context *Context) (Placement, error) {
+		*calledName = "fake-b"
+		return &RandomPlacement{}, nil
+	})
+	t.Cleanup(func() {
+		placementRegistryMutex.Lock()
+		delete(placementRegistry, "fake-a")
+		delete(placementRegistry, "fake-b")
+		placementRegistryMutex.Unlock()
+	})
+	return calledName
+}
+
+func TestNewPlacementByNameDispatch(t *testing.T) {
+	called := registerFakeStrategies(t)
+
+	p, err := newPlacementByName("fake-b", nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+	assert.Equal(t, "fake-b", *called)
+}
+
+func TestNewPlacementByNameDefaultsWhenEmpty(t *testing.T) {
+	placementRegistryMutex.Lock()
+	original := placementRegistry[defaultPlacementStrategy]
+	placementRegistryMutex.Unlock()
+	t.Cleanup(func() {
+		placementRegistryMutex.Lock()
+		placementRegistry[defaultPlacementStrategy] = original
+		placementRegistryMutex.Unlock()
+	})
+
+	var resolvedName string
+	RegisterPlacement(defaultPlacementStrategy, func(context *Context) (Placement, error) {
+		resolvedName = defaultPlacementStrategy
+		return &RandomPlacement{}, nil
+	})
+
+	p, err := newPlacementByName("", nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+	assert.Equal(t, defaultPlacementStrategy, resolvedName,
+		"an empty strategy name should resolve to defaultPlacementStrategy")
+}
+
+func TestNewPlacementByNameUnknownStrategy(t *testing.T) {
+	_, err := newPlacementByName("does-not-exist", nil)
+	assert.Error(t, err)
+}
+
+func TestRegisterPlacementOverridesExisting(t *testing.T) {
+	called := registerFakeStrategies(t)
+	RegisterPlacement("fake-a", func(context *Context) (Placement, error) {
+		*called = "fake-a-v2"
+		return &RandomPlacement{}, nil
+	})
+
+	_, err := newPlacementByName("fake-a", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "fake-a-v2", *called, "re-registering a name should replace the previous factory")
+}
+
+func TestNewPlacementNotYetReachableFromControllerBootstrap(t *testing.T) {
+	t.Skip("KNOWN GAP: NewPlacement/ControllerConfig.PlacementStrategy dispatch is exercised " +
+		"above in isolation, but the controller's real bootstrap call site -- which still calls " +
+		"NewDistancePlacement directly -- lives outside this package's checkout and hasn't been " +
+		"updated to call NewPlacement instead. Until that one-line change lands, PlacementStrategy " +
+		"config has no effect on a running controller. Remove this skip once that call site is " +
+		"updated and a test can exercise it end to end.")
+}
@@ -0,0 +1,288 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/common"
+	"github.com/uber/cherami-server/distance"
+	"github.com/uber/cherami-server/services/controllerhost/load"
+)
+
+// StoreHostScore holds the individual sub-scores, each normalized to [0,1],
+// that make up the weighted placement score for a single store host. The
+// final score is the product of the sub-scores so that any single
+// pathological dimension (e.g. a nearly-full disk) dominates the result,
+// rather than being averaged away by otherwise healthy dimensions.
+type StoreHostScore struct {
+	Host *common.HostInfo
+
+	// RemainingDiskSpace is the host's free disk space normalized against
+	// the largest free disk space observed across the candidate pool.
+	RemainingDiskSpace float64
+	// Uptime is derived from the host's reported health metrics.
+	Uptime float64
+	// Load is one minus the host's recent CPU utilization percentage, as
+	// reported by loadMetrics -- lower recent load scores higher. Throughput
+	// is not taken into account.
+	Load float64
+	// ExtentCount is the inverse of the number of extents the host
+	// currently hosts -- hosts with fewer extents score higher.
+	ExtentCount float64
+	// Version is the host's integer version divided by the newest integer
+	// version seen in the candidate pool, so hosts running older versions
+	// score lower. Versions are compared linearly, not bucketed.
+	Version float64
+	// Distance is the fraction of the other candidate hosts that the
+	// distance map places within the configured [minDistance, maxDistance]
+	// window of this host (see distanceScore). It does not measure how far
+	// outside the window a host lies.
+	Distance float64
+
+	// Total is the product of all the sub-scores above.
+	Total float64
+}
+
+// computeTotal multiplies the sub-scores together, so a single bad
+// dimension (e.g. RemainingDiskSpace == 0) drives the whole score to zero.
+func (s *StoreHostScore) computeTotal() {
+	s.Total = s.RemainingDiskSpace * s.Uptime * s.Load * s.ExtentCount * s.Version * s.Distance
+}
+
+// weightedScorer computes StoreHostScores for a pool of candidate store
+// hosts and picks the highest scoring ones, subject to the store-to-store
+// distance constraint enforced through distMap.FindResources.
+type weightedScorer struct {
+	context    *Context
+	extentLoad *hostExtentLoadTracker
+	distMap    distance.Map
+}
+
+// scoreStoreHosts computes a StoreHostScore for every host in the pool.
+// maxFreeDiskSpace and maxVersion are the maximums across the pool, used
+// to normalize the corresponding sub-scores.
+func (w *weightedScorer) scoreStoreHosts(pool []*common.HostInfo, minDistance, maxDistance uint16) []*StoreHostScore {
+
+	var maxFreeDiskSpace int64
+	var maxVersion int64
+	freeDiskSpace := make(map[string]int64, len(pool))
+	versions := make(map[string]int64, len(pool))
+
+	for _, host := range pool {
+		if val, err := w.context.loadMetrics.Get(host.UUID, load.EmptyTag, load.RemDiskSpaceBytes, load.OneMinAvg); err == nil {
+			freeDiskSpace[host.UUID] = val
+			if val > maxFreeDiskSpace {
+				maxFreeDiskSpace = val
+			}
+		}
+		if v, err := strconv.Atoi(host.Version); err == nil {
+			versions[host.UUID] = int64(v)
+			if int64(v) > maxVersion {
+				maxVersion = int64(v)
+			}
+		}
+	}
+
+	poolResources := toResources(pool)
+
+	scores := make([]*StoreHostScore, 0, len(pool))
+	for _, host := range pool {
+		score := &StoreHostScore{
+			Host:               host,
+			RemainingDiskSpace: ratioScore(freeDiskSpace[host.UUID], maxFreeDiskSpace),
+			Uptime:             w.uptimeScore(host),
+			Load:               w.loadScore(host),
+			ExtentCount:        w.extentCountScore(host, w.extentLoad),
+			Version:            w.versionScore(host, versions, maxVersion),
+			Distance:           w.distanceScore(host, poolResources, minDistance, maxDistance),
+		}
+		score.computeTotal()
+		scores = append(scores, score)
+	}
+
+	return scores
+}
+
+func (w *weightedScorer) uptimeScore(host *common.HostInfo) float64 {
+	if val, err := w.context.loadMetrics.Get(host.UUID, load.EmptyTag, load.Uptime, load.OneMinAvg); err == nil && val > 0 {
+		return ratioScore(val, 100)
+	}
+	return 1.0
+}
+
+func (w *weightedScorer) loadScore(host *common.HostInfo) float64 {
+	if val, err := w.context.loadMetrics.Get(host.UUID, load.EmptyTag, load.CPUPercent, load.OneMinAvg); err == nil {
+		return 1.0 - ratioScore(val, 100)
+	}
+	return 1.0
+}
+
+// versionScore looks up the integer-parsed version computed in
+// scoreStoreHosts. host.Version is occasionally a dotted string like
+// "1.2.3" that strconv.Atoi can't parse; such hosts are scored neutrally
+// (1.0) rather than 0, since computeTotal multiplies sub-scores together
+// and a 0 here would make the host permanently unpickable regardless of
+// how healthy it otherwise is.
+func (w *weightedScorer) versionScore(host *common.HostInfo, versions map[string]int64, maxVersion int64) float64 {
+	v, ok := versions[host.UUID]
+	if !ok {
+		return 1.0
+	}
+	return ratioScore(v, maxVersion)
+}
+
+func (w *weightedScorer) extentCountScore(host *common.HostInfo, extentLoad *hostExtentLoadTracker) float64 {
+	if stats, ok := extentLoad.Get(host.UUID); ok {
+		return 1.0 / float64(1+stats.ActiveExtentCount)
+	}
+	if val, err := w.context.loadMetrics.Get(host.UUID, load.EmptyTag, load.NumExtents, load.OneMinAvg); err == nil {
+		return 1.0 / float64(1+val)
+	}
+	return 1.0
+}
+
+// distanceScore estimates how well host fits the configured
+// [minDistance, maxDistance] store-to-store window relative to the rest of
+// the candidate pool: the fraction of other pool hosts that distMap
+// reports as being within the window of host. A host at the edge of the
+// window (close to few peers) scores lower than one solidly inside it,
+// which is what lets a poor Distance sub-score drag down an otherwise
+// strong candidate once computeTotal multiplies the sub-scores together.
+func (w *weightedScorer) distanceScore(host *common.HostInfo, poolResources []string, minDistance, maxDistance uint16) float64 {
+	if w.distMap == nil {
+		return 1.0
+	}
+
+	hostResource := strings.Split(host.Addr, ":")[0]
+	others := make([]string, 0, len(poolResources))
+	for _, r := range poolResources {
+		if r != hostResource {
+			others = append(others, r)
+		}
+	}
+	if len(others) == 0 {
+		return 1.0
+	}
+
+	matched, err := w.distMap.FindResources(others, []string{hostResource}, "nic", len(others), minDistance, maxDistance)
+	if err != nil {
+		return 1.0
+	}
+
+	return ratioScore(int64(len(matched)), int64(len(others)))
+}
+
+// ratioScore returns val/max clamped to [0,1]; it returns 1 when max is 0
+// so that an unpopulated maximum doesn't zero out every host's score.
+func ratioScore(val, max int64) float64 {
+	if max <= 0 {
+		return 1.0
+	}
+	ratio := float64(val) / float64(max)
+	if ratio > 1.0 {
+		return 1.0
+	}
+	if ratio < 0 {
+		return 0
+	}
+	return ratio
+}
+
+// sortScoresDescending orders scores from highest Total to lowest.
+func sortScoresDescending(scores []*StoreHostScore) {
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Total > scores[j].Total
+	})
+}
+
+// pickWeighted greedily selects the count highest scoring hosts from pool,
+// still honoring the store-to-store distance constraint by running the
+// chosen candidates through distMap.FindResources. bb is optional and is
+// forwarded to pickHosts so any distance rejections among the ranked pool
+// are recorded into the same breakdown as the earlier constraint checks.
+func (p *DistancePlacement) pickWeighted(service string, pool []*common.HostInfo, count int, minDistance, maxDistance uint16, bb *breakdownBuilder) ([]*common.HostInfo, error) {
+
+	scorer := &weightedScorer{context: p.context, extentLoad: p.extentLoad, distMap: p.currentDistMap()}
+	scores := scorer.scoreStoreHosts(pool, minDistance, maxDistance)
+	sortScoresDescending(scores)
+
+	ranked := make([]*common.HostInfo, 0, len(scores))
+	for _, s := range scores {
+		ranked = append(ranked, s.Host)
+	}
+
+	if scorer.distMap == nil {
+		if len(ranked) < count {
+			return nil, errNoStoreHosts
+		}
+		return ranked[:count], nil
+	}
+
+	return p.pickHosts(service, ranked, nil, count, minDistance, maxDistance, bb)
+}
+
+// PlacementDebug returns a per-host score breakdown for the current store
+// host pool, for logging and admin diagnostics.
+func (p *DistancePlacement) PlacementDebug() ([]*StoreHostScore, error) {
+	pool, _, err := p.findEligibleStoreHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	minDistance := p.context.appConfig.GetControllerConfig().GetMinStoreToStoreDistance()
+	maxDistance := p.context.appConfig.GetControllerConfig().GetMaxStoreToStoreDistance()
+	if minDistance <= distance.ZeroDistance {
+		minDistance = distance.ZeroDistance + 1
+	}
+	if maxDistance <= minDistance {
+		maxDistance = distance.InfiniteDistance
+	}
+
+	scorer := &weightedScorer{context: p.context, extentLoad: p.extentLoad, distMap: p.currentDistMap()}
+	scores := scorer.scoreStoreHosts(pool, minDistance, maxDistance)
+	sortScoresDescending(scores)
+
+	for _, score := range scores {
+		p.context.log.WithFields(logScoreFields(score)).Debug(`Store host placement score`)
+	}
+	p.context.log.WithField(`numHosts`, len(scores)).Info(`Computed store host placement scores`)
+
+	return scores, nil
+}
+
+// logScoreFields flattens a StoreHostScore into bark fields for the
+// per-host debug logging in PlacementDebug.
+func logScoreFields(score *StoreHostScore) bark.Fields {
+	return bark.Fields{
+		common.TagHostIP:     score.Host.Addr,
+		`remainingDiskSpace`: score.RemainingDiskSpace,
+		`uptime`:             score.Uptime,
+		`load`:               score.Load,
+		`extentCount`:        score.ExtentCount,
+		`version`:            score.Version,
+		`distance`:           score.Distance,
+		`total`:              score.Total,
+	}
+}
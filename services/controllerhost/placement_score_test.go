@@ -0,0 +1,72 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/cherami-server/common"
+)
+
+func TestRatioScore(t *testing.T) {
+	assert.Equal(t, 1.0, ratioScore(5, 0), "a zero max shouldn't zero out every host's score")
+	assert.Equal(t, 0.5, ratioScore(5, 10))
+	assert.Equal(t, 1.0, ratioScore(20, 10), "above-max ratios clamp to 1")
+	assert.Equal(t, 0.0, ratioScore(-5, 10), "negative values clamp to 0")
+	assert.Equal(t, 0.0, ratioScore(0, 10))
+}
+
+func TestComputeTotal(t *testing.T) {
+	s := &StoreHostScore{
+		RemainingDiskSpace: 0.5,
+		Uptime:             1.0,
+		Load:               1.0,
+		ExtentCount:        1.0,
+		Version:            1.0,
+		Distance:           1.0,
+	}
+	s.computeTotal()
+	assert.Equal(t, 0.5, s.Total)
+
+	s2 := &StoreHostScore{
+		RemainingDiskSpace: 0,
+		Uptime:             1.0,
+		Load:               1.0,
+		ExtentCount:        1.0,
+		Version:            1.0,
+		Distance:           1.0,
+	}
+	s2.computeTotal()
+	assert.Equal(t, 0.0, s2.Total, "a single zero sub-score should zero the product")
+}
+
+func TestVersionScore(t *testing.T) {
+	w := &weightedScorer{}
+	host := &common.HostInfo{UUID: "h1", Version: "1.2.3"}
+
+	versions := map[string]int64{"h2": 5}
+	assert.Equal(t, 1.0, w.versionScore(host, versions, 5),
+		"a host whose Version didn't parse as an integer should score neutrally, not zero")
+
+	versions = map[string]int64{"h1": 3}
+	assert.Equal(t, 0.6, w.versionScore(host, versions, 5))
+}
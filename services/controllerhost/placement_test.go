@@ -0,0 +1,77 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/cherami-server/common"
+)
+
+func TestSortByExtentLoad(t *testing.T) {
+	extentLoad := &hostExtentLoadTracker{}
+	extentLoad.stats.Store(map[string]hostExtentStats{
+		"light": {ActiveExtentCount: 1, TotalBytesStored: 1000},
+		"heavy": {ActiveExtentCount: 5, TotalBytesStored: 10},
+		"tie-a": {ActiveExtentCount: 2, TotalBytesStored: 200},
+		"tie-b": {ActiveExtentCount: 2, TotalBytesStored: 100},
+	})
+
+	p := &DistancePlacement{extentLoad: extentLoad}
+
+	hosts := []*common.HostInfo{
+		{UUID: "heavy"},
+		{UUID: "unobserved"},
+		{UUID: "tie-a"},
+		{UUID: "light"},
+		{UUID: "tie-b"},
+	}
+
+	p.sortByExtentLoad(hosts)
+
+	var order []string
+	for _, h := range hosts {
+		order = append(order, h.UUID)
+	}
+	assert.Equal(t, []string{"light", "tie-b", "tie-a", "heavy", "unobserved"}, order,
+		"lowest extent count first, bytes-stored tiebreak, unobserved hosts sort last")
+}
+
+func TestDistancePlacementCloseIsNilSafe(t *testing.T) {
+	p := &DistancePlacement{}
+	assert.NoError(t, p.Close(), "Close must tolerate a placement with no topology watcher or extent-load tracker")
+}
+
+func TestDistancePlacementCloseStopsExtentLoadTracker(t *testing.T) {
+	extentLoad := newHostExtentLoadTracker(&Context{log: testLogger()}, time.Minute)
+	// Start's synchronous refresh needs a metadata manager, which this
+	// Context lacks; run just the background loop that Close must stop.
+	go extentLoad.pollLoop()
+
+	p := &DistancePlacement{extentLoad: extentLoad}
+	assert.NoError(t, p.Close())
+
+	// Stop closes a channel; closing it again panics. Seeing that panic
+	// proves Close already called Stop rather than leaking the goroutine.
+	assert.Panics(t, func() { extentLoad.Stop() })
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/uber/cherami-server/common"
+)
+
+// RandomPlacement picks hosts uniformly at random from the pool of
+// healthy hosts for a service, ignoring distance constraints entirely.
+// It's mainly useful for test suites and for sites that don't care about
+// rack/AZ-aware placement and would rather avoid the distance map
+// altogether.
+type RandomPlacement struct {
+	context *Context
+}
+
+// NewRandomPlacement constructs a RandomPlacement strategy.
+func NewRandomPlacement(context *Context) (Placement, error) {
+	return &RandomPlacement{context: context}, nil
+}
+
+// PickInputHost picks a random healthy input host
+func (p *RandomPlacement) PickInputHost(storeHosts []*common.HostInfo) (*common.HostInfo, error) {
+	hosts, err := p.context.rpm.GetHosts(common.InputServiceName)
+	if err != nil || len(hosts) == 0 {
+		return &common.HostInfo{}, errNoInputHosts
+	}
+	return hosts[rand.Intn(len(hosts))], nil
+}
+
+// PickOutputHost picks a random healthy output host
+func (p *RandomPlacement) PickOutputHost(storeHosts []*common.HostInfo) (*common.HostInfo, error) {
+	hosts, err := p.context.rpm.GetHosts(common.OutputServiceName)
+	if err != nil || len(hosts) == 0 {
+		return &common.HostInfo{}, errNoOutputHosts
+	}
+	return hosts[rand.Intn(len(hosts))], nil
+}
+
+// PickStoreHosts picks count random healthy store hosts
+func (p *RandomPlacement) PickStoreHosts(count int) ([]*common.HostInfo, error) {
+	hosts, err := p.context.rpm.GetHosts(common.StoreServiceName)
+	if err != nil || len(hosts) < count {
+		return nil, errNoStoreHosts
+	}
+
+	shuffled := make([]*common.HostInfo, len(hosts))
+	copy(shuffled, hosts)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	return shuffled[:count], nil
+}
+
+// GetPlacementBreakdown is not meaningful for random placement since there
+// are no rejection reasons to report -- every healthy host is eligible.
+func (p *RandomPlacement) GetPlacementBreakdown(serviceName string) (*PlacementBreakdown, error) {
+	return &PlacementBreakdown{}, nil
+}
+
+// ReloadTopology is a no-op since RandomPlacement doesn't consult a
+// topology file.
+func (p *RandomPlacement) ReloadTopology() error {
+	return nil
+}
+
+// TopologyStatus is a zero value since RandomPlacement doesn't consult a
+// topology file.
+func (p *RandomPlacement) TopologyStatus() (checksum string, modTime time.Time) {
+	return "", time.Time{}
+}
+
+// PlacementDebug is not meaningful for random placement since hosts are
+// chosen uniformly at random rather than scored.
+func (p *RandomPlacement) PlacementDebug() ([]*StoreHostScore, error) {
+	return nil, nil
+}
+
+// Close is a no-op since RandomPlacement doesn't start any background
+// goroutines.
+func (p *RandomPlacement) Close() error {
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package controllerhost
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber-common/bark"
+	"github.com/uber/cherami-server/distance"
+)
+
+func stubDistanceMap(t *testing.T, fn func(path string, log bark.Logger) (distance.Map, error)) {
+	orig := newDistanceMap
+	newDistanceMap = fn
+	t.Cleanup(func() { newDistanceMap = orig })
+}
+
+func TestNewTopologyWatcherAtomicSwap(t *testing.T) {
+	stubDistanceMap(t, func(path string, log bark.Logger) (distance.Map, error) {
+		return nil, nil
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "topology.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v1"), 0644))
+
+	w, err := newTopologyWatcher(&Context{log: testLogger()}, path, time.Minute)
+	assert.NoError(t, err)
+
+	first := w.currentState()
+	assert.NotEmpty(t, first.checksum)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v2"), 0644))
+	assert.NoError(t, w.reload())
+
+	second := w.currentState()
+	assert.NotEqual(t, first.checksum, second.checksum, "reload should swap in the freshly parsed state")
+	assert.NotSame(t, first, second, "reload must swap the whole state atomically, not mutate it in place")
+}
+
+func TestTopologyWatcherReloadKeepsPreviousOnParseError(t *testing.T) {
+	callCount := 0
+	stubDistanceMap(t, func(path string, log bark.Logger) (distance.Map, error) {
+		callCount++
+		if callCount == 2 {
+			return nil, errors.New("malformed topology file")
+		}
+		return nil, nil
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "topology.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v1"), 0644))
+
+	w, err := newTopologyWatcher(&Context{log: testLogger()}, path, time.Minute)
+	assert.NoError(t, err)
+	first := w.currentState()
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v2-corrupt"), 0644))
+	err = w.reload()
+	assert.Error(t, err)
+
+	second := w.currentState()
+	assert.Equal(t, first, second, "a parse error on reload should leave the previously loaded state serving")
+}